@@ -0,0 +1,78 @@
+package digest_auth_client
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"strings"
+)
+
+// defaultAlgorithmPreference lists the algorithms this client negotiates,
+// strongest first, when DigestTransport.Algorithms/DigestRequest.Algorithms
+// hasn't restricted the set.
+var defaultAlgorithmPreference = []string{"SHA-512-256", "SHA-256", "MD5"}
+
+// splitAlgorithm separates the "-sess" suffix from a digest algorithm
+// directive, e.g. "SHA-256-sess" -> ("SHA-256", true). An empty directive
+// means MD5, per RFC 7616 section 3.4.
+func splitAlgorithm(algorithm string) (base string, sess bool) {
+	algorithm = strings.TrimSpace(algorithm)
+	if algorithm == "" {
+		return "MD5", false
+	}
+	if rest, ok := strings.CutSuffix(algorithm, "-sess"); ok {
+		return rest, true
+	}
+	return algorithm, false
+}
+
+// hashHex returns the hex-encoded digest of s computed with the named base
+// algorithm (no "-sess" suffix), or false if it isn't one this client
+// implements.
+func hashHex(algorithm, s string) (string, bool) {
+	switch strings.ToUpper(algorithm) {
+	case "MD5":
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:]), true
+	case "SHA-256":
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:]), true
+	case "SHA-512-256":
+		sum := sha512.Sum512_256([]byte(s))
+		return hex.EncodeToString(sum[:]), true
+	default:
+		return "", false
+	}
+}
+
+// newHasher returns a fresh hash.Hash for the named base algorithm (no
+// "-sess" suffix), or false if it isn't one this client implements. Used to
+// stream-hash a request's entity body for qop="auth-int" without buffering
+// it into a string.
+func newHasher(algorithm string) (hash.Hash, bool) {
+	switch strings.ToUpper(algorithm) {
+	case "MD5":
+		return md5.New(), true
+	case "SHA-256":
+		return sha256.New(), true
+	case "SHA-512-256":
+		return sha512.New512_256(), true
+	default:
+		return nil, false
+	}
+}
+
+// algorithmRank returns algorithm's preference index within allowed (lower
+// is stronger/preferred), ignoring any "-sess" suffix, or -1 if allowed
+// doesn't include it.
+func algorithmRank(algorithm string, allowed []string) int {
+	base, _ := splitAlgorithm(algorithm)
+	for i, a := range allowed {
+		if strings.EqualFold(a, base) {
+			return i
+		}
+	}
+	return -1
+}
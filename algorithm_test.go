@@ -0,0 +1,103 @@
+package digest_auth_client
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestSplitAlgorithm(t *testing.T) {
+	cases := []struct {
+		algorithm string
+		wantBase  string
+		wantSess  bool
+	}{
+		{"", "MD5", false},
+		{"MD5", "MD5", false},
+		{"MD5-sess", "MD5", true},
+		{"SHA-256", "SHA-256", false},
+		{"SHA-256-sess", "SHA-256", true},
+		{"SHA-512-256", "SHA-512-256", false},
+		{"SHA-512-256-sess", "SHA-512-256", true},
+	}
+
+	for _, c := range cases {
+		base, sess := splitAlgorithm(c.algorithm)
+		if base != c.wantBase || sess != c.wantSess {
+			t.Errorf("splitAlgorithm(%q) = (%q, %v), want (%q, %v)", c.algorithm, base, sess, c.wantBase, c.wantSess)
+		}
+	}
+}
+
+func TestHashHex(t *testing.T) {
+	cases := []struct {
+		algorithm string
+		input     string
+		want      string
+		wantOk    bool
+	}{
+		{"MD5", "hello", "5d41402abc4b2a76b9719d911017c592", true},
+		{"md5", "hello", "5d41402abc4b2a76b9719d911017c592", true},
+		{"SHA-256", "hello", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", true},
+		{"SHA-512-256", "hello", "e30d87cfa2a75db545eac4d61baf970366a8357c7f72fa95b52d0accb698f13a", true},
+		{"bogus", "hello", "", false},
+	}
+
+	for _, c := range cases {
+		got, ok := hashHex(c.algorithm, c.input)
+		if ok != c.wantOk {
+			t.Fatalf("hashHex(%q, ...) ok = %v, want %v", c.algorithm, ok, c.wantOk)
+		}
+		if ok && got != c.want {
+			t.Errorf("hashHex(%q, %q) = %q, want %q", c.algorithm, c.input, got, c.want)
+		}
+	}
+}
+
+func TestNewHasherMatchesHashHex(t *testing.T) {
+	for _, algorithm := range []string{"MD5", "SHA-256", "SHA-512-256"} {
+		h, ok := newHasher(algorithm)
+		if !ok {
+			t.Fatalf("newHasher(%q) reported unsupported", algorithm)
+		}
+		h.Write([]byte("streamed"))
+
+		want, ok := hashHex(algorithm, "streamed")
+		if !ok {
+			t.Fatalf("hashHex(%q, ...) reported unsupported", algorithm)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			t.Errorf("newHasher(%q) sum = %q, want %q", algorithm, got, want)
+		}
+	}
+
+	if _, ok := newHasher("bogus"); ok {
+		t.Error("newHasher(\"bogus\") reported supported")
+	}
+}
+
+func TestAlgorithmRank(t *testing.T) {
+	allowed := defaultAlgorithmPreference // SHA-512-256, SHA-256, MD5
+
+	cases := []struct {
+		algorithm string
+		want      int
+	}{
+		{"", 2}, // empty means MD5 per RFC 7616 3.4
+		{"MD5", 2},
+		{"MD5-sess", 2},
+		{"SHA-256", 1},
+		{"SHA-256-sess", 1},
+		{"SHA-512-256", 0},
+		{"bogus", -1},
+	}
+
+	for _, c := range cases {
+		if got := algorithmRank(c.algorithm, allowed); got != c.want {
+			t.Errorf("algorithmRank(%q, defaultAlgorithmPreference) = %d, want %d", c.algorithm, got, c.want)
+		}
+	}
+
+	if got := algorithmRank("MD5", []string{"SHA-256"}); got != -1 {
+		t.Errorf("algorithmRank(%q, []string{%q}) = %d, want -1", "MD5", "SHA-256", got)
+	}
+}
@@ -0,0 +1,82 @@
+package digest_auth_client
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestComputeResponseAuthInt(t *testing.T) {
+	body := "the quick brown fox"
+	dr := &DigestRequest{
+		Method:   "POST",
+		Username: "Mufasa",
+		Password: "Circle Of Life",
+		GetBody: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(body)), nil
+		},
+	}
+	ah := &authorization{
+		Algorithm: "SHA-256",
+		Cnonce:    "cnonce",
+		Nc:        1,
+		Nonce:     "nonce",
+		Qop:       "auth-int",
+		Realm:     "realm",
+		Uri:       "/upload",
+	}
+
+	bodyHash, _ := hashHex("SHA-256", body)
+	ha1, _ := hashHex("SHA-256", "Mufasa:realm:Circle Of Life")
+	ha2, _ := hashHex("SHA-256", "POST:/upload:"+bodyHash)
+	want, _ := hashHex("SHA-256", ha1+":nonce:00000001:cnonce:auth-int:"+ha2)
+
+	got, err := ah.computeResponse(dr)
+	if err != nil {
+		t.Fatalf("computeResponse() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("computeResponse() with qop=auth-int = %q, want %q", got, want)
+	}
+}
+
+func TestComputeResponseAuthIntRequiresGetBody(t *testing.T) {
+	dr := &DigestRequest{Method: "POST", Username: "u", Password: "p"}
+	ah := &authorization{Algorithm: "MD5", Nonce: "n", Qop: "auth-int", Realm: "r", Uri: "/x"}
+
+	if _, err := ah.computeResponse(dr); err == nil {
+		t.Error("computeResponse() with qop=auth-int and no GetBody = nil error, want error")
+	}
+}
+
+func TestPickQop(t *testing.T) {
+	cases := []struct {
+		name         string
+		offered      string
+		wantAuthInt  bool
+		bodySeekable bool
+		want         string
+		wantErr      bool
+	}{
+		{"no qop offered", "", false, true, "", false},
+		{"auth only", "auth", false, true, "auth", false},
+		{"prefers auth over auth-int by default", "auth,auth-int", false, true, "auth", false},
+		{"opts into auth-int", "auth,auth-int", true, true, "auth-int", false},
+		{"opts into auth-int but body not seekable", "auth,auth-int", true, false, "auth", false},
+		{"only auth-int offered, seekable", "auth-int", false, true, "auth-int", false},
+		{"only auth-int offered, not seekable", "auth-int", false, false, "", true},
+		{"unsupported qop", "bogus", false, true, "", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := pickQop(c.offered, c.wantAuthInt, c.bodySeekable)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("pickQop(%q, %v, %v) error = %v, wantErr %v", c.offered, c.wantAuthInt, c.bodySeekable, err, c.wantErr)
+			}
+			if err == nil && got != c.want {
+				t.Errorf("pickQop(%q, %v, %v) = %q, want %q", c.offered, c.wantAuthInt, c.bodySeekable, got, c.want)
+			}
+		})
+	}
+}
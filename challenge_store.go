@@ -0,0 +1,195 @@
+package digest_auth_client
+
+import (
+	"net/url"
+	"sync"
+)
+
+// Challenge is the exported, serializable form of a negotiated digest
+// challenge. ChallengeStore implementations persist it together with the
+// associated nonce count so a DigestTransport can resume an authenticated
+// sequence across process restarts instead of spending a fresh 401
+// handshake and burning a nonce on the server.
+type Challenge struct {
+	Algorithm string
+	Domain    string
+	Nonce     string
+	Opaque    string
+	Qop       string
+	Realm     string
+	Stale     bool
+	Userhash  bool
+	// AuthHeader is the request header credentials for this challenge are
+	// sent back on: "Authorization" for a WWW-Authenticate challenge,
+	// "Proxy-Authorization" for a Proxy-Authenticate one.
+	AuthHeader string
+}
+
+// ChallengeStore persists the digest challenge and nonce count negotiated
+// for a protection space, keyed the same way as DigestTransport's preemptive
+// cache (scheme://host, see challengeCacheKey). Load returns (nil, 0, nil)
+// when nothing is stored for key. Implementations must be safe for
+// concurrent use, since a DigestTransport may be shared across goroutines by
+// an http.Client.
+//
+// DigestTransport.Store defaults to an in-memory implementation, so state
+// does not survive a restart unless a persistent ChallengeStore is supplied.
+// A FileStore backed by on-disk JSON might look like:
+//
+//	type FileStore struct {
+//		Path string
+//		mu   sync.Mutex
+//	}
+//
+//	func (f *FileStore) Load(key string) (*digest.Challenge, uint32, error) {
+//		f.mu.Lock()
+//		defer f.mu.Unlock()
+//
+//		entries, err := f.readAll()
+//		if err != nil {
+//			return nil, 0, err
+//		}
+//		entry, ok := entries[key]
+//		if !ok {
+//			return nil, 0, nil
+//		}
+//		return entry.Challenge, entry.Nc, nil
+//	}
+//
+//	func (f *FileStore) Save(key string, ch *digest.Challenge, nc uint32) error {
+//		f.mu.Lock()
+//		defer f.mu.Unlock()
+//
+//		entries, err := f.readAll()
+//		if err != nil {
+//			return err
+//		}
+//		entries[key] = fileStoreEntry{Challenge: ch, Nc: nc}
+//		return f.writeAll(entries)
+//	}
+//
+//	func (f *FileStore) Reserve(key string) (*digest.Challenge, uint32, error) {
+//		f.mu.Lock()
+//		defer f.mu.Unlock()
+//
+//		entries, err := f.readAll()
+//		if err != nil {
+//			return nil, 0, err
+//		}
+//		entry, ok := entries[key]
+//		if !ok {
+//			return nil, 0, nil
+//		}
+//		entry.Nc++
+//		entries[key] = entry
+//		if err := f.writeAll(entries); err != nil {
+//			return nil, 0, err
+//		}
+//		return entry.Challenge, entry.Nc, nil
+//	}
+//
+// readAll/writeAll marshal entries as JSON to/from f.Path with os.ReadFile
+// and os.WriteFile.
+type ChallengeStore interface {
+	Load(key string) (*Challenge, uint32, error)
+	Save(key string, ch *Challenge, nc uint32) error
+	// Reserve atomically loads the challenge stored for key and hands out
+	// the next nonce count to use with it, persisting the increment before
+	// returning so two concurrent callers never receive the same nc for the
+	// same nonce - which a strict server would otherwise reject as a
+	// replay. It returns (nil, 0, nil) when nothing is stored for key, the
+	// same as Load.
+	Reserve(key string) (*Challenge, uint32, error)
+}
+
+// memoryChallengeStore is the ChallengeStore used by a DigestTransport whose
+// Store field is left nil: state lives only as long as the process, the
+// same behaviour a DigestTransport had before ChallengeStore existed.
+type memoryChallengeStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryChallengeEntry
+}
+
+type memoryChallengeEntry struct {
+	challenge *Challenge
+	nc        uint32
+}
+
+func (s *memoryChallengeStore) Load(key string) (*Challenge, uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, 0, nil
+	}
+	return entry.challenge, entry.nc, nil
+}
+
+func (s *memoryChallengeStore) Save(key string, ch *Challenge, nc uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entries == nil {
+		s.entries = make(map[string]memoryChallengeEntry)
+	}
+	s.entries[key] = memoryChallengeEntry{challenge: ch, nc: nc}
+	return nil
+}
+
+func (s *memoryChallengeStore) Reserve(key string) (*Challenge, uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, 0, nil
+	}
+	entry.nc++
+	s.entries[key] = entry
+	return entry.challenge, entry.nc, nil
+}
+
+// toChallenge converts the internal wwwAuthenticate representation to the
+// Challenge type a ChallengeStore persists.
+func (wa *wwwAuthenticate) toChallenge() *Challenge {
+	if wa == nil {
+		return nil
+	}
+	return &Challenge{
+		Algorithm: wa.Algorithm,
+		Domain:    wa.Domain,
+		Nonce:     wa.Nonce,
+		Opaque:    wa.Opaque,
+		Qop:       wa.Qop,
+		Realm:     wa.Realm,
+		Stale:     wa.Stale,
+		Userhash:  wa.Userhash,
+	}
+}
+
+// wwwAuthenticateFromChallenge rebuilds the internal wwwAuthenticate
+// representation from a Challenge loaded out of a ChallengeStore.
+func wwwAuthenticateFromChallenge(ch *Challenge) *wwwAuthenticate {
+	if ch == nil {
+		return nil
+	}
+	return &wwwAuthenticate{
+		Algorithm: ch.Algorithm,
+		Domain:    ch.Domain,
+		Nonce:     ch.Nonce,
+		Opaque:    ch.Opaque,
+		Qop:       ch.Qop,
+		Realm:     ch.Realm,
+		Stale:     ch.Stale,
+		Userhash:  ch.Userhash,
+	}
+}
+
+// challengeCacheKey identifies the protection space a challenge belongs to.
+// RFC 7616 ties the protection space to realm+domain, but scheme+host is a
+// practical approximation that matches what most servers actually scope
+// their nonces to.
+func challengeCacheKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,114 @@
+package digest_auth_client
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMemoryChallengeStoreLoadSave(t *testing.T) {
+	s := &memoryChallengeStore{}
+
+	if ch, nc, err := s.Load("key"); err != nil || ch != nil || nc != 0 {
+		t.Fatalf("Load() on empty store = (%v, %d, %v), want (nil, 0, nil)", ch, nc, err)
+	}
+
+	ch := &Challenge{Realm: "r", Nonce: "n"}
+	if err := s.Save("key", ch, 1); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	gotCh, gotNc, err := s.Load("key")
+	if err != nil || gotNc != 1 || gotCh.Nonce != "n" {
+		t.Fatalf("Load() after Save = (%+v, %d, %v), want nonce n, nc 1", gotCh, gotNc, err)
+	}
+}
+
+func TestMemoryChallengeStoreReserve(t *testing.T) {
+	s := &memoryChallengeStore{}
+
+	if ch, nc, err := s.Reserve("key"); err != nil || ch != nil || nc != 0 {
+		t.Fatalf("Reserve() on empty store = (%v, %d, %v), want (nil, 0, nil)", ch, nc, err)
+	}
+
+	if err := s.Save("key", &Challenge{Nonce: "n"}, 1); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	for want := uint32(2); want <= 4; want++ {
+		ch, nc, err := s.Reserve("key")
+		if err != nil {
+			t.Fatalf("Reserve() error = %v", err)
+		}
+		if ch == nil || ch.Nonce != "n" {
+			t.Fatalf("Reserve() challenge = %+v, want nonce n", ch)
+		}
+		if nc != want {
+			t.Errorf("Reserve() nc = %d, want %d", nc, want)
+		}
+	}
+}
+
+// TestMemoryChallengeStoreReserveConcurrent guards against the nc-reuse race
+// a plain Load-then-Save pair has under concurrent RoundTrip calls: every
+// concurrent Reserve for the same key must come back with a distinct nc.
+func TestMemoryChallengeStoreReserveConcurrent(t *testing.T) {
+	s := &memoryChallengeStore{}
+	if err := s.Save("key", &Challenge{Nonce: "n"}, 0); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	const goroutines = 50
+	ncs := make([]uint32, goroutines)
+
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			_, nc, err := s.Reserve("key")
+			if err != nil {
+				t.Errorf("Reserve() error = %v", err)
+				return
+			}
+			ncs[i] = nc
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[uint32]bool, goroutines)
+	for _, nc := range ncs {
+		if seen[nc] {
+			t.Fatalf("Reserve() handed out duplicate nc %d across concurrent callers", nc)
+		}
+		seen[nc] = true
+	}
+}
+
+func TestChallengeConversionRoundTrip(t *testing.T) {
+	wa := &wwwAuthenticate{
+		Algorithm: "SHA-256",
+		Domain:    "/",
+		Nonce:     "n",
+		Opaque:    "o",
+		Qop:       "auth",
+		Realm:     "r",
+		Stale:     true,
+		Userhash:  true,
+	}
+
+	got := wwwAuthenticateFromChallenge(wa.toChallenge())
+	if *got != *wa {
+		t.Errorf("wwwAuthenticateFromChallenge(wa.toChallenge()) = %+v, want %+v", got, wa)
+	}
+
+	if wa.toChallenge() == nil {
+		t.Error("toChallenge() on non-nil wwwAuthenticate = nil")
+	}
+	var nilWa *wwwAuthenticate
+	if nilWa.toChallenge() != nil {
+		t.Error("toChallenge() on nil wwwAuthenticate != nil")
+	}
+	if wwwAuthenticateFromChallenge(nil) != nil {
+		t.Error("wwwAuthenticateFromChallenge(nil) != nil")
+	}
+}
@@ -3,38 +3,96 @@ package digest_auth_client
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"net/http"
-	"time"
+	"strings"
+	"sync"
 )
 
 type DigestRequest struct {
-	Context  context.Context
-	Client   *http.Client
-	Body     string
-	Method   string
-	Password string
-	Uri      string
-	Username string
-	Header   http.Header
-	Auth     *authorization
-	Wa       *wwwAuthenticate
-	messages string
-	logging  bool
+	Context   context.Context
+	Transport http.RoundTripper
+	Body      string
+	Method    string
+	Password  string
+	Uri       string
+	Username  string
+	Header    http.Header
+	Auth      *authorization
+	Wa        *wwwAuthenticate
+	Logger    Logger
+	// Algorithms restricts which digest algorithms this request will accept
+	// from the server's challenge, strongest preference first. A nil or
+	// empty slice accepts defaultAlgorithmPreference (SHA-512-256, SHA-256,
+	// then MD5).
+	Algorithms []string
+	// GetBody, when set, returns a fresh reader of the request body on each
+	// call - mirroring http.Request.GetBody - so a retry can rewind a large
+	// or streamed body instead of buffering it in memory. It takes
+	// precedence over Body. NewDigestRequest/NewDigestRequestWithContext
+	// leave it nil; DigestTransport populates it automatically from the
+	// wrapped http.Request.
+	GetBody func() (io.ReadCloser, error)
+	// AuthInt opts this request into the qop="auth-int" quality-of-protection
+	// variant when the server offers it and GetBody is set. auth-int hashes
+	// the request body into HA2, so it is skipped when the body can't be
+	// replayed for the authenticated retry.
+	AuthInt bool
+	// FindChallenge, when set, overrides how the challenge is extracted from
+	// a 401/407 response - for servers that put it under a nonstandard
+	// header - and which request header the computed credentials are sent
+	// back on. It defaults to reading WWW-Authenticate/Authorization on 401
+	// and Proxy-Authenticate/Proxy-Authorization on 407.
+	FindChallenge func(resp *http.Response) (ch *Challenge, authHeader string, err error)
+	// AuthHeader is the request header the current Auth was negotiated for
+	// ("Authorization" or "Proxy-Authorization", unless FindChallenge says
+	// otherwise). It is set by executeNewDigest and read by
+	// executeDigestRequest; callers don't normally need to set it.
+	AuthHeader string
 }
 
+// DigestTransport is an http.RoundTripper that performs RFC 7616 digest
+// authentication on top of a wrapped base Transport, so it can be dropped
+// straight into http.Client.Transport.
 type DigestTransport struct {
-	Client   *http.Client
-	Password string
-	Username string
-	logging  bool
+	// Transport is the underlying RoundTripper that performs the actual
+	// HTTP round trips. It defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+	Password  string
+	Username  string
+	Logger    Logger
+	// Algorithms restricts which digest algorithms this transport will
+	// accept from a server's challenge, strongest preference first. A nil
+	// or empty slice accepts defaultAlgorithmPreference (SHA-512-256,
+	// SHA-256, then MD5). Set this to []string{"SHA-256", "SHA-512-256"}
+	// to disable MD5, e.g. for FIPS compliance.
+	Algorithms []string
+	// AuthInt opts this transport's requests into the qop="auth-int"
+	// quality-of-protection variant when the server offers it and the
+	// request body is replayable (i.e. req.GetBody is set).
+	AuthInt bool
+	// Store persists negotiated challenges and nonce counts between
+	// RoundTrip calls - and, if backed by something other than memory,
+	// across process restarts. It defaults to an in-memory store.
+	Store ChallengeStore
+	// FindChallenge, when set, overrides how the challenge is extracted from
+	// a 401/407 response - for servers that put it under a nonstandard
+	// header - and which request header the computed credentials are sent
+	// back on. It defaults to reading WWW-Authenticate/Authorization on 401
+	// and Proxy-Authenticate/Proxy-Authorization on 407.
+	FindChallenge func(resp *http.Response) (ch *Challenge, authHeader string, err error)
+
+	defaultStoreOnce sync.Once
+	defaultStore     *memoryChallengeStore
 }
 
 // NewDigestRequest creates a new DigestRequest object
 func NewDigestRequest(username, password, method, uri, body string, client *http.Client, header http.Header) DigestRequest {
 	dr := DigestRequest{}
-	dr.log("DigestRequest created in NewDigestRequest()")
 	dr.UpdateRequestWithContext(context.Background(), username, password, method, uri, body, client, header)
+	dr.log("DigestRequest created in NewDigestRequest()")
 	return dr
 }
 
@@ -42,34 +100,110 @@ func NewDigestRequest(username, password, method, uri, body string, client *http
 //  object passing along the provided context
 func NewDigestRequestWithContext(ctx context.Context, username, password, method, uri, body string, client *http.Client, header http.Header) DigestRequest {
 	dr := DigestRequest{}
-	dr.log("DigestRequest created in NewDigestRequestWithContext()")
 	dr.UpdateRequestWithContext(ctx, username, password, method, uri, body, client, header)
+	dr.log("DigestRequest created in NewDigestRequestWithContext()")
 	return dr
 }
 
-// NewDigestTransport creates a new DigestTransport object
-func NewDigestTransport(username, password string, client *http.Client) DigestTransport {
-	dt := DigestTransport{}
-	dt.Client = client
+// NewDigestTransport creates a new DigestTransport that authenticates
+// requests with username/password, forwarding the actual round trips to
+// transport. If transport is nil, http.DefaultTransport is used.
+//
+// It returns a *DigestTransport, not a DigestTransport, because the struct
+// embeds a sync.Once guarding its lazily-created default Store; copying a
+// DigestTransport by value after that Once has fired copies its lock too,
+// which both go vet and the race detector flag.
+func NewDigestTransport(username, password string, transport http.RoundTripper) *DigestTransport {
+	dt := &DigestTransport{}
+	dt.Transport = transport
 	dt.Password = password
 	dt.Username = username
 	return dt
 }
 
-func (dt *DigestTransport) SetLogging(enabled bool) {
-	dt.logging = enabled
+// SetLogger installs logger to receive diagnostic messages. Passing nil
+// disables logging.
+func (dt *DigestTransport) SetLogger(logger Logger) {
+	dt.Logger = logger
 }
 
-func (dr *DigestRequest) SetLogging(enabled bool) {
-	dr.log("Logging set to %t", enabled) // Either of these logs will be effective if switching...
-	dr.logging = enabled
-	dr.log("Logging set to %t", enabled) // Either of these logs will be effective if switching...
+// SetLogger installs logger to receive diagnostic messages. Passing nil
+// disables logging.
+func (dr *DigestRequest) SetLogger(logger Logger) {
+	dr.Logger = logger
+	dr.log("Logger installed")
 }
 
 func (dr *DigestRequest) log(format string, args ...any) {
-	if dr.logging {
-		dr.messages += fmt.Sprintf(format+"\n", args)
+	if dr.Logger != nil {
+		dr.Logger.Logf(format, args...)
+	}
+}
+
+func (dr *DigestRequest) transport() http.RoundTripper {
+	if dr.Transport != nil {
+		return dr.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (dr *DigestRequest) allowedAlgorithms() []string {
+	if len(dr.Algorithms) > 0 {
+		return dr.Algorithms
+	}
+	return defaultAlgorithmPreference
+}
+
+// newRequest builds an *http.Request for dr's method/uri/headers, sourcing
+// the body from GetBody when set (so it can be replayed on a retry without
+// ever being buffered as a string) and falling back to the legacy Body
+// string otherwise.
+func (dr *DigestRequest) newRequest() (*http.Request, error) {
+	req, err := http.NewRequestWithContext(dr.Context, dr.Method, dr.Uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case dr.GetBody != nil:
+		body, err := dr.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+		req.GetBody = dr.GetBody
+	case dr.Body != "":
+		req.Body = io.NopCloser(strings.NewReader(dr.Body))
+	}
+
+	dr.addHeaders(req)
+	return req, nil
+}
+
+// hashBody returns the hex-encoded digest of the request's entity body,
+// computed with the given base algorithm, for the qop="auth-int" H(entity-
+// body) term. It requires GetBody so the body can still be sent on the
+// actual request after being read here.
+func (dr *DigestRequest) hashBody(algorithm string) (string, error) {
+	if dr.GetBody == nil {
+		return "", fmt.Errorf("digest: auth-int requires a replayable request body")
+	}
+
+	body, err := dr.GetBody()
+	if err != nil {
+		return "", err
 	}
+	defer body.Close()
+
+	h, ok := newHasher(algorithm)
+	if !ok {
+		return "", fmt.Errorf("digest: unsupported algorithm %q", algorithm)
+	}
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 // UpdateRequest is called when you want to reuse an existing
@@ -83,7 +217,7 @@ func (dr *DigestRequest) UpdateRequest(username, password, method, uri, body str
 	dr.Password = password
 	dr.Uri = uri
 	dr.Username = username
-	dr.Client = client
+	dr.Transport = transportFromClient(client)
 	dr.Header = header
 	return dr
 }
@@ -99,137 +233,271 @@ func (dr *DigestRequest) UpdateRequestWithContext(ctx context.Context, username,
 	dr.Password = password
 	dr.Uri = uri
 	dr.Username = username
-	dr.Client = client
+	dr.Transport = transportFromClient(client)
 	dr.Header = header
 	return dr
 }
 
-// RoundTrip implements the http.RoundTripper interface
-func (dt *DigestTransport) RoundTrip(req *http.Request) (resp *http.Response, err error, messages string) {
-	ctx := req.Context()
-	username := dt.Username
-	password := dt.Password
-	method := req.Method
-	uri := req.URL.String()
-	header := req.Header
+// transportFromClient extracts the RoundTripper a *http.Client would use,
+// defaulting to http.DefaultTransport the way http.Client itself does.
+func transportFromClient(client *http.Client) http.RoundTripper {
+	if client != nil && client.Transport != nil {
+		return client.Transport
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip implements the http.RoundTripper interface. It performs a single
+// request on the wrapped Transport and, if the server challenges with a 401,
+// retries once with a computed Authorization header - all on the same
+// Transport, so cookie jars, redirect handling and connection pooling set up
+// on an outer http.Client keep working.
+//
+// If a challenge has already been observed for the request's scheme+host,
+// it is reused to send an Authorization header on the very first attempt,
+// avoiding the 401 round trip entirely unless the cached nonce turns out to
+// be stale.
+func (dt *DigestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	dr := &DigestRequest{
+		Context:       req.Context(),
+		Transport:     dt.transportOrDefault(),
+		Method:        req.Method,
+		Uri:           req.URL.String(),
+		Username:      dt.Username,
+		Password:      dt.Password,
+		Header:        req.Header,
+		Logger:        dt.Logger,
+		Algorithms:    dt.Algorithms,
+		AuthInt:       dt.AuthInt,
+		FindChallenge: dt.FindChallenge,
+	}
 
-	var body string
 	if req.Body != nil {
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(req.Body)
-		body = buf.String()
+		if req.GetBody != nil {
+			dr.GetBody = req.GetBody
+		} else {
+			// req carries no way to replay its body (e.g. it was built
+			// directly from an io.Reader); buffer it once so the
+			// authenticated retry can still be sent.
+			buf := new(bytes.Buffer)
+			if _, err := buf.ReadFrom(req.Body); err != nil {
+				return nil, err
+			}
+			data := buf.Bytes()
+			dr.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(data)), nil
+			}
+		}
+	}
+
+	key := challengeCacheKey(req.URL)
+	// Reserve atomically loads the cached challenge and hands out the next
+	// nc to use with it in one step, so two goroutines racing on the same
+	// host never reuse each other's nc - which dr.Auth.refreshAuthorization
+	// would otherwise bump independently from a stale Load, producing a
+	// duplicate nc a strict server rejects as a replay.
+	ch, nc, err := dt.store().Reserve(key)
+	if err != nil {
+		return nil, err
+	}
+	var cachedAuth *authorization
+	if ch != nil {
+		dr.log("RoundTrip() - reusing stored challenge for %s", key)
+		dr.Wa = wwwAuthenticateFromChallenge(ch)
+		dr.AuthHeader = ch.AuthHeader
+		auth, err := newAuthorization(dr)
+		if err != nil {
+			return nil, err
+		}
+		// refreshAuthorization increments Nc before the request is sent, so
+		// pre-set it one below the value Reserve already persisted.
+		auth.Nc = nc - 1
+		dr.Auth = auth
+		cachedAuth = auth
 	}
 
-	dr := NewDigestRequestWithContext(ctx, username, password, method, uri, body, dt.Client, header)
-	dr.SetLogging(dt.logging)
-	return dr.Execute()
+	resp, err := dr.Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	// A stale cached nonce causes Execute to drop dr.Auth and renegotiate a
+	// fresh challenge, swapping in a new *authorization. Only that case (or
+	// the no-cache case, where cachedAuth is nil) needs a Save: Reserve
+	// already persisted the nc for a successful reuse of cachedAuth, and
+	// overwriting it here could roll back a higher nc a concurrent caller
+	// has since reserved.
+	if dr.Wa != nil && dr.Auth != nil && dr.Auth != cachedAuth && !isChallengeStatus(resp.StatusCode) {
+		ch := dr.Wa.toChallenge()
+		ch.AuthHeader = dr.AuthHeader
+		if err := dt.store().Save(key, ch, dr.Auth.Nc); err != nil {
+			dr.log("RoundTrip() - failed to persist challenge for %s: %v", key, err)
+		}
+	}
+
+	return resp, nil
+}
+
+// isChallengeStatus reports whether code is a status this client reacts to
+// by extracting a digest challenge and retrying: 401 Unauthorized from the
+// origin server, or 407 Proxy Authentication Required from a proxy.
+func isChallengeStatus(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusProxyAuthRequired
+}
+
+func (dt *DigestTransport) transportOrDefault() http.RoundTripper {
+	if dt.Transport != nil {
+		return dt.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (dt *DigestTransport) store() ChallengeStore {
+	if dt.Store != nil {
+		return dt.Store
+	}
+	dt.defaultStoreOnce.Do(func() {
+		dt.defaultStore = &memoryChallengeStore{}
+	})
+	return dt.defaultStore
 }
 
 // Execute initialise the request and get a response
-func (dr *DigestRequest) Execute() (resp *http.Response, err error, messages string) {
+func (dr *DigestRequest) Execute() (resp *http.Response, err error) {
 	dr.log("Execute()")
 
 	if dr.Auth != nil {
 		dr.log("Execute() - dr.Auth != nil")
-		return dr.executeExistingDigest()
+		if resp, err = dr.executeExistingDigest(); err != nil {
+			return nil, err
+		}
+		if !isChallengeStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		// cached/reused credentials were rejected - the nonce is most
+		// likely stale or the protection space has changed, so drop them
+		// and renegotiate from the fresh challenge in resp.
+		dr.log("Execute() - existing credentials rejected with %d, renegotiating", resp.StatusCode)
+		dr.Auth = nil
+		return dr.executeNewDigest(resp)
 	}
 
 	var req *http.Request
-	if req, err = http.NewRequestWithContext(dr.Context, dr.Method, dr.Uri, bytes.NewReader([]byte(dr.Body))); err != nil {
-		dr.log("Error in Execute() in call to http.NewRequestWithContext()")
-		return nil, err, dr.messages
-	}
-	dr.addHeaders(req)
-
-	if dr.Client == nil {
-		dr.log("Execute() - dr.Client == nil")
-		dr.Client = &http.Client{
-			Timeout: 30 * time.Second,
-		}
+	if req, err = dr.newRequest(); err != nil {
+		dr.log("Error in Execute() in call to newRequest()")
+		return nil, err
 	}
 
-	if resp, err = dr.Client.Do(req); err != nil {
-		dr.log("Error in Execute() in call to dr.Client.Do(): %v", err)
-		return nil, err, dr.messages
+	if resp, err = dr.transport().RoundTrip(req); err != nil {
+		dr.log("Error in Execute() in call to Transport.RoundTrip(): %v", err)
+		return nil, err
 	}
 
-	if resp.StatusCode == 401 {
-		dr.log("Execute() - response was status 401, calling executeNewDigest()\n")
+	if isChallengeStatus(resp.StatusCode) {
+		dr.log("Execute() - response was status %d, calling executeNewDigest()\n", resp.StatusCode)
 		return dr.executeNewDigest(resp)
 	}
 
 	// return the resp to user to handle resp.body.Close()
-	dr.log("Execute() - no 401, sending back the response")
-	return resp, nil, dr.messages
+	dr.log("Execute() - no challenge, sending back the response")
+	return resp, nil
 }
 
-func (dr *DigestRequest) executeNewDigest(resp *http.Response) (resp2 *http.Response, err error, messages string) {
-	var (
-		auth     *authorization
-		wa       *wwwAuthenticate
-		waString string
-	)
+func (dr *DigestRequest) executeNewDigest(resp *http.Response) (resp2 *http.Response, err error) {
+	var auth *authorization
 
 	dr.log("executeNewDigest()")
 
 	// body not required for authentication, closing
 	resp.Body.Close()
 
-	if waString = resp.Header.Get("WWW-Authenticate"); waString == "" {
-		dr.log("executeNewDigest() - Failed to get WWW-Authenticate header: %v", err)
-		return nil, fmt.Errorf("failed to get WWW-Authenticate header, please check your server configuration"), dr.messages
+	ch, authHeader, err := dr.findChallenge(resp)
+	if err != nil {
+		dr.log("executeNewDigest() - findChallenge() failed: %v", err)
+		return nil, err
 	}
-	wa = newWwwAuthenticate(waString)
-	dr.Wa = wa
+	dr.Wa = wwwAuthenticateFromChallenge(ch)
+	dr.AuthHeader = authHeader
 
 	if auth, err = newAuthorization(dr); err != nil {
 		dr.log("executeNewDigest() - newAuthorization() failed: %v", err)
-		return nil, err, dr.messages
+		return nil, err
 	}
 
-	if resp2, err, _ = dr.executeDigestRequest(auth.toString()); err != nil {
+	if resp2, err = dr.executeDigestRequest(auth.toString()); err != nil {
 		dr.log("executeNewDigest() - executeDigestRequest() failed: %v", err)
-		return nil, err, dr.messages
+		return nil, err
 	}
 
 	dr.Auth = auth
-	return resp2, nil, dr.messages
+	return resp2, nil
+}
+
+// findChallenge extracts the challenge and the header credentials should be
+// sent back on, delegating to dr.FindChallenge when set.
+func (dr *DigestRequest) findChallenge(resp *http.Response) (*Challenge, string, error) {
+	if dr.FindChallenge != nil {
+		return dr.FindChallenge(resp)
+	}
+	return dr.defaultFindChallenge(resp)
+}
+
+// defaultFindChallenge reads WWW-Authenticate on a 401 and Proxy-Authenticate
+// on a 407, picking the offered challenge whose algorithm this client most
+// prefers.
+func (dr *DigestRequest) defaultFindChallenge(resp *http.Response) (*Challenge, string, error) {
+	challengeHeader, authHeader := "WWW-Authenticate", "Authorization"
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		challengeHeader, authHeader = "Proxy-Authenticate", "Proxy-Authorization"
+	}
+
+	challenges := resp.Header.Values(challengeHeader)
+	if len(challenges) == 0 {
+		return nil, "", fmt.Errorf("failed to get %s header, please check your server configuration", challengeHeader)
+	}
+
+	wa := selectChallenge(challenges, dr.allowedAlgorithms())
+	if wa == nil {
+		return nil, "", fmt.Errorf("server only offered digest algorithms unsupported by this client")
+	}
+
+	return wa.toChallenge(), authHeader, nil
 }
 
-func (dr *DigestRequest) executeExistingDigest() (resp *http.Response, err error, messages string) {
+func (dr *DigestRequest) executeExistingDigest() (resp *http.Response, err error) {
 	var auth *authorization
 
 	dr.log("executeExistingDigest()\n")
 
 	if auth, err = dr.Auth.refreshAuthorization(dr); err != nil {
 		dr.log("executeExistingDigest() - refreshAuthorization() failed: %v", err)
-		return nil, err, dr.messages
+		return nil, err
 	}
 	dr.Auth = auth
 
 	return dr.executeDigestRequest(dr.Auth.toString())
 }
 
-func (dr *DigestRequest) executeDigestRequest(authString string) (resp *http.Response, err error, messages string) {
+func (dr *DigestRequest) executeDigestRequest(authString string) (resp *http.Response, err error) {
 	var req *http.Request
 
 	dr.log("executeDigestRequest()")
 
-	if req, err = http.NewRequestWithContext(dr.Context, dr.Method, dr.Uri, bytes.NewReader([]byte(dr.Body))); err != nil {
-		dr.log("executeDigestRequest() - NewRequestWithContext failed: %v", err)
-		return nil, err, dr.messages
+	if req, err = dr.newRequest(); err != nil {
+		dr.log("executeDigestRequest() - newRequest failed: %v", err)
+		return nil, err
 	}
-	dr.addHeaders(req)
-	req.Header.Add("Authorization", authString)
+	req.Header.Add(dr.authHeaderOrDefault(), authString)
 
-	if dr.Client == nil {
-		dr.log("executeDigestRequest() - dr.Client == nil")
-		dr.Client = &http.Client{}
-	}
+	dr.log("executeDigestRequest() - Calling Transport.RoundTrip()")
+	return dr.transport().RoundTrip(req)
+}
 
-	dr.log("executeDigestRequest() - Calling Client.Do()")
-	resp, err = dr.Client.Do(req)
-	return resp, err, dr.messages
+func (dr *DigestRequest) authHeaderOrDefault() string {
+	if dr.AuthHeader != "" {
+		return dr.AuthHeader
+	}
+	return "Authorization"
 }
 
 func (dr *DigestRequest) addHeaders(req *http.Request) {
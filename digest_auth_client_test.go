@@ -0,0 +1,123 @@
+package digest_auth_client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+var ncDirective = regexp.MustCompile(`nc=([0-9a-fA-F]+)`)
+
+// digestTestServer replies 401 with a fixed MD5 challenge until it sees an
+// Authorization header, then replies 200 and records the nc it was sent.
+type digestTestServer struct {
+	mu  sync.Mutex
+	ncs []uint32
+}
+
+func (s *digestTestServer) handler(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		w.Header().Set("WWW-Authenticate", `Digest realm="test", qop="auth", algorithm=MD5, nonce="abcdef0123456789"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	m := ncDirective.FindStringSubmatch(auth)
+	if m == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	nc, err := strconv.ParseUint(m[1], 16, 32)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.ncs = append(s.ncs, uint32(nc))
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestRoundTripReusesChallengeWithIncreasingNc(t *testing.T) {
+	srv := &digestTestServer{}
+	ts := httptest.NewServer(http.HandlerFunc(srv.handler))
+	defer ts.Close()
+
+	dt := NewDigestTransport("user", "pass", nil)
+	client := &http.Client{Transport: dt}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("Get() #%d error = %v", i, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Get() #%d status = %d, want 200", i, resp.StatusCode)
+		}
+	}
+
+	srv.mu.Lock()
+	ncs := append([]uint32(nil), srv.ncs...)
+	srv.mu.Unlock()
+
+	if len(ncs) != 3 {
+		t.Fatalf("server saw %d authenticated requests, want 3 (nc sequence %v)", len(ncs), ncs)
+	}
+	for i := 1; i < len(ncs); i++ {
+		if ncs[i] <= ncs[i-1] {
+			t.Errorf("nc sequence %v is not strictly increasing at index %d", ncs, i)
+		}
+	}
+}
+
+func TestRoundTripConcurrentRequestsUseDistinctNc(t *testing.T) {
+	srv := &digestTestServer{}
+	ts := httptest.NewServer(http.HandlerFunc(srv.handler))
+	defer ts.Close()
+
+	dt := NewDigestTransport("user", "pass", nil)
+	client := &http.Client{Transport: dt}
+
+	// Warm the cache with one request so the rest skip the 401 round trip
+	// and race on the preemptive path Reserve guards.
+	if resp, err := client.Get(ts.URL); err != nil {
+		t.Fatalf("warmup Get() error = %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(ts.URL)
+			if err != nil {
+				t.Errorf("concurrent Get() error = %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	srv.mu.Lock()
+	ncs := append([]uint32(nil), srv.ncs...)
+	srv.mu.Unlock()
+
+	seen := make(map[uint32]bool, len(ncs))
+	for _, nc := range ncs {
+		if seen[nc] {
+			t.Fatalf("server saw duplicate nc %d across concurrent requests (nc sequence %v)", nc, ncs)
+		}
+		seen[nc] = true
+	}
+}
@@ -0,0 +1,9 @@
+package digest_auth_client
+
+// Logger receives diagnostic messages describing the digest negotiation
+// performed by a DigestRequest or DigestTransport. Implementations must be
+// safe to call from RoundTrip, which may be invoked from multiple
+// goroutines.
+type Logger interface {
+	Logf(format string, args ...any)
+}
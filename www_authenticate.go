@@ -0,0 +1,143 @@
+package digest_auth_client
+
+import "strings"
+
+// wwwAuthenticate holds the challenge parameters offered by a server in a
+// WWW-Authenticate digest challenge header.
+type wwwAuthenticate struct {
+	Algorithm string
+	Domain    string
+	Nonce     string
+	Opaque    string
+	Qop       string
+	Realm     string
+	Stale     bool
+	Userhash  bool
+}
+
+// newWwwAuthenticate parses the value of a WWW-Authenticate header into a
+// wwwAuthenticate. Only the "Digest" scheme is understood.
+func newWwwAuthenticate(header string) *wwwAuthenticate {
+	wa := wwwAuthenticate{}
+
+	s := strings.TrimSpace(header)
+	s = strings.TrimPrefix(s, "Digest ")
+
+	for _, part := range splitDirectives(s) {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		val = strings.Trim(strings.TrimSpace(val), `"`)
+
+		switch strings.ToLower(key) {
+		case "algorithm":
+			wa.Algorithm = val
+		case "domain":
+			wa.Domain = val
+		case "nonce":
+			wa.Nonce = val
+		case "opaque":
+			wa.Opaque = val
+		case "qop":
+			wa.Qop = val
+		case "realm":
+			wa.Realm = val
+		case "stale":
+			wa.Stale = strings.EqualFold(val, "true")
+		case "userhash":
+			wa.Userhash = strings.EqualFold(val, "true")
+		}
+	}
+
+	return &wa
+}
+
+// selectChallenge parses each WWW-Authenticate challenge in challenges -
+// servers may offer several, e.g. one per algorithm, either as repeated
+// header lines or comma-joined onto a single line - and returns the one
+// whose algorithm is most preferred according to allowed. It returns nil if
+// none of the challenges use an algorithm this client supports.
+func selectChallenge(challenges []string, allowed []string) *wwwAuthenticate {
+	var best *wwwAuthenticate
+	bestRank := -1
+
+	for _, raw := range challenges {
+		for _, one := range splitChallenges(raw) {
+			trimmed := strings.TrimSpace(one)
+			if !strings.HasPrefix(strings.ToLower(trimmed), "digest") {
+				continue
+			}
+
+			wa := newWwwAuthenticate(trimmed)
+			rank := algorithmRank(wa.Algorithm, allowed)
+			if rank == -1 {
+				continue
+			}
+			if best == nil || rank < bestRank {
+				best, bestRank = wa, rank
+			}
+		}
+	}
+
+	return best
+}
+
+// splitChallenges splits a single header value into one string per
+// auth-scheme challenge. A server is allowed to offer several challenges on
+// one WWW-Authenticate line (e.g. "Digest ...algorithm=MD5..., Digest
+// ...algorithm=SHA-256..."), and naively treating the whole value as one
+// challenge merges both sets of directives, corrupting algorithm
+// negotiation. splitDirectives only tells directives apart from each other;
+// this also tells a challenge boundary apart from a directive-separating
+// comma.
+func splitChallenges(value string) []string {
+	var challenges []string
+
+	for _, tok := range splitDirectives(value) {
+		if len(challenges) == 0 || startsNewChallenge(tok) {
+			challenges = append(challenges, strings.TrimSpace(tok))
+			continue
+		}
+		challenges[len(challenges)-1] += "," + tok
+	}
+
+	return challenges
+}
+
+// startsNewChallenge reports whether tok - one comma-separated token from
+// splitDirectives - opens a new auth-scheme challenge (e.g. `Digest
+// realm="x"`) rather than continuing the directive list of the challenge
+// before it (e.g. ` qop="auth"`). A directive is always "name=value"; a new
+// challenge's first token is instead a bare scheme name followed by
+// whitespace and its first "name=value" directive.
+func startsNewChallenge(tok string) bool {
+	fields := strings.Fields(tok)
+	if len(fields) < 2 {
+		return false
+	}
+	return !strings.Contains(fields[0], "=") && strings.Contains(fields[1], "=")
+}
+
+// splitDirectives splits a comma-separated list of digest directives,
+// respecting commas inside quoted values (e.g. qop="auth,auth-int").
+func splitDirectives(s string) []string {
+	var parts []string
+	var inQuotes bool
+	start := 0
+
+	for i, r := range s {
+		switch r {
+		case '"':
+			inQuotes = !inQuotes
+		case ',':
+			if !inQuotes {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, s[start:])
+	return parts
+}
@@ -0,0 +1,89 @@
+package digest_auth_client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewWwwAuthenticate(t *testing.T) {
+	header := `Digest realm="testrealm@host.com", qop="auth,auth-int", algorithm=SHA-256, nonce="abc123", opaque="xyz", stale=TRUE, userhash=true`
+
+	got := newWwwAuthenticate(header)
+	want := &wwwAuthenticate{
+		Algorithm: "SHA-256",
+		Nonce:     "abc123",
+		Opaque:    "xyz",
+		Qop:       "auth,auth-int",
+		Realm:     "testrealm@host.com",
+		Stale:     true,
+		Userhash:  true,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newWwwAuthenticate() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSplitChallenges(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{
+			name:  "single challenge",
+			value: `Digest realm="r", qop="auth", nonce="n"`,
+			want:  []string{`Digest realm="r", qop="auth", nonce="n"`},
+		},
+		{
+			name:  "two challenges on one line",
+			value: `Digest realm="r", algorithm=MD5, nonce="n1", Digest realm="r", algorithm=SHA-256, nonce="n2"`,
+			want: []string{
+				`Digest realm="r", algorithm=MD5, nonce="n1"`,
+				`Digest realm="r", algorithm=SHA-256, nonce="n2"`,
+			},
+		},
+		{
+			name:  "qop value containing a comma doesn't split",
+			value: `Digest realm="r", qop="auth,auth-int", nonce="n"`,
+			want:  []string{`Digest realm="r", qop="auth,auth-int", nonce="n"`},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := splitChallenges(c.value)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("splitChallenges(%q) = %q, want %q", c.value, got, c.want)
+			}
+		})
+	}
+}
+
+func TestSelectChallenge(t *testing.T) {
+	// One header line offering MD5 and SHA-256 challenges - a client that
+	// prefers SHA-256 should pick the second one, not a wwwAuthenticate
+	// merged from both.
+	challenges := []string{
+		`Digest realm="r", algorithm=MD5, nonce="n1", qop="auth", Digest realm="r", algorithm=SHA-256, nonce="n2", qop="auth"`,
+	}
+
+	wa := selectChallenge(challenges, defaultAlgorithmPreference)
+	if wa == nil {
+		t.Fatal("selectChallenge() = nil, want a challenge")
+	}
+	if wa.Algorithm != "SHA-256" || wa.Nonce != "n2" {
+		t.Errorf("selectChallenge() = %+v, want algorithm SHA-256 with nonce n2", wa)
+	}
+
+	// A client restricted to MD5 only should fall back to the first one.
+	wa = selectChallenge(challenges, []string{"MD5"})
+	if wa == nil || wa.Algorithm != "MD5" || wa.Nonce != "n1" {
+		t.Errorf("selectChallenge() restricted to MD5 = %+v, want algorithm MD5 with nonce n1", wa)
+	}
+
+	// None of the offered algorithms are acceptable.
+	if wa := selectChallenge(challenges, []string{"SHA-512-256"}); wa != nil {
+		t.Errorf("selectChallenge() with no acceptable algorithm = %+v, want nil", wa)
+	}
+}